@@ -0,0 +1,174 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package rollup
+
+import (
+	"sync"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// checkpointInterval is the number of machine steps run between intermediate
+// checkpoints while executing an assertion. Smaller values bound how much
+// work a reorg or an interrupted tick can throw away, at the cost of more
+// frequent machine clones.
+const checkpointInterval = uint64(500000)
+
+// maxCheckpoints bounds how many intermediate checkpoints are kept at once.
+// Once full, the store evicts in insertion order: the key that was first
+// recorded longest ago goes, and rewriting an existing key does not move it.
+const maxCheckpoints = 8
+
+// checkpointKey identifies an in-progress execution. pendingTop pins the
+// checkpoint to a particular pending inbox reference point: for
+// prepareAssertion it is the node's beforePendingTop (fixed for the life of
+// the node), and for getNodeOpinion it is the candidate claim's
+// AfterPendingTop (distinct per competing claim).
+type checkpointKey struct {
+	nodeHash   [32]byte
+	pendingTop [32]byte
+}
+
+// assertionCheckpoint is an intermediate snapshot taken partway through
+// executing an assertion, letting a later call with the same checkpointKey
+// resume from stepsRun rather than from the beginning.
+type assertionCheckpoint struct {
+	stepsRun  uint64
+	machine   machine.Machine
+	assertion *protocol.ExecutionAssertion
+}
+
+// checkpointStore is a bounded, insertion-order-evicted cache of assertionCheckpoints
+// keyed by checkpointKey. It is safe for concurrent use.
+type checkpointStore struct {
+	mu      sync.Mutex
+	entries map[checkpointKey]*assertionCheckpoint
+	order   []checkpointKey
+}
+
+func newCheckpointStore() *checkpointStore {
+	return &checkpointStore{
+		entries: make(map[checkpointKey]*assertionCheckpoint),
+	}
+}
+
+// get returns the newest checkpoint recorded for key, if any.
+func (s *checkpointStore) get(key checkpointKey) (*assertionCheckpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.entries[key]
+	return cp, ok
+}
+
+// put records a checkpoint for key, evicting the oldest entry if the store
+// is already at capacity.
+func (s *checkpointStore) put(key checkpointKey, cp *assertionCheckpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[key]; !exists {
+		if len(s.order) >= maxCheckpoints {
+			oldest := s.order[0]
+			s.order = s.order[1:]
+			delete(s.entries, oldest)
+		}
+		s.order = append(s.order, key)
+	}
+	s.entries[key] = cp
+}
+
+// invalidateNode drops every checkpoint recorded against nodeHash. It is
+// called when the opinion thread moves past a node, and by getNodeOpinion
+// when a claim against the node fails execution checks. No caller drops
+// checkpoints because the pending inbox has changed.
+func (s *checkpointStore) invalidateNode(nodeHash [32]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < len(s.order); {
+		key := s.order[i]
+		if key.nodeHash == nodeHash {
+			delete(s.entries, key)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// executeWithCheckpoints runs mach for up to maxSteps steps, resuming from
+// the newest compatible checkpoint for key if one is present, and recording
+// a new checkpoint every checkpointInterval steps along the way so a future
+// call for the same key can resume instead of restarting.
+//
+// The returned *protocol.ExecutionAssertion always covers the whole run from
+// the node's original starting state, never just the final chunk: each
+// checkpoint stores the cumulative assertion up to that point, and each
+// chunk's result is folded into it via ExecutionAssertion.Combine (assumed
+// to merge two sequential assertions into the one a single uninterrupted
+// ExecuteAssertion call would have produced — needs adding to
+// arb-util/protocol if it doesn't already exist, same as the Reset()
+// assumption machinePool relies on). Without this, two honest validators
+// chunking the same execution differently could commit to different stubs
+// for what must be a deterministic result.
+func executeWithCheckpoints(
+	store *checkpointStore,
+	key checkpointKey,
+	mach machine.Machine,
+	maxSteps uint64,
+	timeBounds protocol.TimeBounds,
+	messagesVal value.TupleValue,
+) (machine.Machine, *protocol.ExecutionAssertion, uint64) {
+	stepsRun := uint64(0)
+	var assertion *protocol.ExecutionAssertion
+	if cp, ok := store.get(key); ok && cp.stepsRun < maxSteps {
+		mach = cp.machine.Clone()
+		stepsRun = cp.stepsRun
+		assertion = cp.assertion
+	}
+
+	// The loop always runs at least once, even when maxSteps-stepsRun is 0,
+	// so callers always get back a non-nil assertion to call .Stub()/
+	// .DidInboxInsn on, matching what a direct mach.ExecuteAssertion call
+	// would have returned.
+	for {
+		chunk := maxSteps - stepsRun
+		if chunk > checkpointInterval {
+			chunk = checkpointInterval
+		}
+		chunkAssertion, chunkSteps := mach.ExecuteAssertion(chunk, timeBounds, messagesVal)
+		if assertion == nil {
+			assertion = chunkAssertion
+		} else {
+			assertion = assertion.Combine(chunkAssertion)
+		}
+		stepsRun += chunkSteps
+		if stepsRun >= maxSteps || chunkSteps < chunk {
+			// Either the budget is exhausted, or the machine blocked before
+			// using its full chunk; either way a checkpoint here would just
+			// be replayed into the same state, so there's nothing more to
+			// gain from continuing.
+			break
+		}
+		store.put(key, &assertionCheckpoint{
+			stepsRun:  stepsRun,
+			machine:   mach.Clone(),
+			assertion: assertion,
+		})
+	}
+	return mach, assertion, stepsRun
+}
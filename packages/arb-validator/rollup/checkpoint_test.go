@@ -0,0 +1,86 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package rollup
+
+import (
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// TestExecuteWithCheckpointsMergesChunks exercises the bug class the
+// chunk0-1 review caught: running more than one checkpointInterval's worth
+// of steps, whether in a single call or split across a resumed checkpoint,
+// must produce an assertion reflecting the whole run, not just its final
+// chunk. fuzzMachine only sets DidInboxInsn on the chunk that starts at step
+// 0, so a buggy overwrite-the-last-chunk implementation would lose it the
+// moment execution needs more than one chunk.
+func TestExecuteWithCheckpointsMergesChunks(t *testing.T) {
+	maxSteps := 2*checkpointInterval + 100
+	timeBounds := protocol.TimeBounds{}
+	messagesVal := value.NewEmptyTuple()
+
+	t.Run("single call spanning multiple chunks", func(t *testing.T) {
+		mach := &fuzzMachine{}
+		_, assertion, stepsRun := executeWithCheckpoints(newCheckpointStore(), checkpointKey{}, mach, maxSteps, timeBounds, messagesVal)
+		if stepsRun != maxSteps {
+			t.Fatalf("stepsRun = %d, want %d", stepsRun, maxSteps)
+		}
+		if !assertion.DidInboxInsn {
+			t.Fatalf("DidInboxInsn from the first chunk was lost across chunk boundaries")
+		}
+	})
+
+	t.Run("resumed from an intermediate checkpoint", func(t *testing.T) {
+		store := newCheckpointStore()
+		key := checkpointKey{}
+		mach, partialAssertion, partialSteps := executeWithCheckpoints(store, key, &fuzzMachine{}, checkpointInterval+1, timeBounds, messagesVal)
+		if partialSteps != checkpointInterval+1 {
+			t.Fatalf("partialSteps = %d, want %d", partialSteps, checkpointInterval+1)
+		}
+		if !partialAssertion.DidInboxInsn {
+			t.Fatalf("expected the first chunk's DidInboxInsn to be preserved through the partial run")
+		}
+
+		// A later call for the same key resumes from the checkpoint the
+		// first call left behind at checkpointInterval steps, rather than
+		// from the machine the first call returned, and runs the remaining
+		// chunks in a second call.
+		_, finalAssertion, finalSteps := executeWithCheckpoints(store, key, mach, maxSteps, timeBounds, messagesVal)
+		if finalSteps != maxSteps {
+			t.Fatalf("finalSteps = %d, want %d", finalSteps, maxSteps)
+		}
+		if !finalAssertion.DidInboxInsn {
+			t.Fatalf("resuming from a checkpoint lost the first chunk's DidInboxInsn: two validators chunking the same execution differently would commit to different stubs")
+		}
+	})
+}
+
+// TestExecuteWithCheckpointsZeroSteps guards against the nil-assertion gap a
+// zero-step budget used to hit: prepareAssertion and getNodeOpinion both
+// dereference the returned assertion unconditionally.
+func TestExecuteWithCheckpointsZeroSteps(t *testing.T) {
+	mach := &fuzzMachine{}
+	_, assertion, stepsRun := executeWithCheckpoints(newCheckpointStore(), checkpointKey{}, mach, 0, protocol.TimeBounds{}, value.NewEmptyTuple())
+	if assertion == nil {
+		t.Fatalf("executeWithCheckpoints(maxSteps=0) returned a nil assertion")
+	}
+	if stepsRun != 0 {
+		t.Fatalf("stepsRun = %d, want 0", stepsRun)
+	}
+}
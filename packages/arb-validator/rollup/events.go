@@ -0,0 +1,82 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package rollup
+
+// ChainEventKind identifies why a ChainEvent was published: which piece of
+// chain state changed and might let the opinion-update thread make progress.
+type ChainEventKind int
+
+const (
+	// NewLeafEvent is published by NotifyNewLeaf, for when the node graph
+	// gains a leaf, e.g. once a staker's assertion is confirmed on L1 and
+	// added as a successor.
+	NewLeafEvent ChainEventKind = iota
+	// NewPendingInboxTopEvent is published by NotifyNewPendingInboxTop, for
+	// when the pending inbox accepts new messages, which may unblock a
+	// machine that was waiting on them.
+	NewPendingInboxTopEvent
+	// NewBlockEvent is published by NotifyNewBlock, for each new L1 block,
+	// which may unblock a machine that was waiting on a block number or
+	// timestamp.
+	NewBlockEvent
+)
+
+// ChainEvent is pushed onto ChainObserver.events by whichever method changed
+// the piece of state Kind names. startOpinionUpdateThread selects on this
+// channel so it can react immediately instead of waiting for its watchdog
+// tick.
+//
+// Scaffolding only, not yet load-bearing: nothing in this checkout calls
+// NotifyNewLeaf/NotifyNewPendingInboxTop/NotifyNewBlock below, so
+// chain.events never actually fires and startOpinionUpdateThread is still
+// driven entirely by its 1s watchdog, same as before this event channel
+// existed. The latency win this was meant to deliver isn't realized yet —
+// whatever code adds a leaf, advances the pending inbox, or observes a new
+// L1 block (none of which exists in this tree) needs to call the matching
+// NotifyNew* method before that's true.
+type ChainEvent struct {
+	Kind ChainEventKind
+}
+
+// publishEvent is a non-blocking send: a slow or absent opinion-thread
+// consumer must never stall the caller that observed the underlying state
+// change, since that caller is usually holding chain.Lock().
+func (chain *ChainObserver) publishEvent(kind ChainEventKind) {
+	select {
+	case chain.events <- ChainEvent{Kind: kind}:
+	default:
+	}
+}
+
+// NotifyNewLeaf must be called once the node graph gains a new leaf, e.g.
+// from whatever L1-watching code confirms a staker's assertion and adds it
+// as a successor.
+func (chain *ChainObserver) NotifyNewLeaf() {
+	chain.publishEvent(NewLeafEvent)
+}
+
+// NotifyNewPendingInboxTop must be called once the pending inbox accepts new
+// messages, since that may unblock a machine that was waiting on them.
+func (chain *ChainObserver) NotifyNewPendingInboxTop() {
+	chain.publishEvent(NewPendingInboxTopEvent)
+}
+
+// NotifyNewBlock must be called on every new L1 block observed, since that
+// may unblock a machine that was waiting on a block number or timestamp.
+func (chain *ChainObserver) NotifyNewBlock() {
+	chain.publishEvent(NewBlockEvent)
+}
@@ -29,6 +29,15 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
 )
 
+// defaultPrepareWorkers is used when ChainParams doesn't specify how many
+// assertions may be prepared concurrently.
+const defaultPrepareWorkers = 2
+
+// maxPreparedAssertions bounds how many completed preparedAssertions are
+// kept at once. Entries beyond this are evicted oldest-first, the same way
+// checkpointStore bounds itself.
+const maxPreparedAssertions = 32
+
 type preparedAssertion struct {
 	leafHash         [32]byte
 	prevPrevLeafHash [32]byte
@@ -58,15 +67,129 @@ func (pa *preparedAssertion) Clone() *preparedAssertion {
 	}
 }
 
+// preparedKey identifies a preparedAssertion by the leaf it extends, the
+// pending-inbox top that leaf starts from (beforeState.PendingTop, the same
+// for every prepare of one leaf) and the time bounds it was prepared under.
+// Results for one leaf with different time bounds are kept side by side
+// rather than one replacing the other; results with equal time bounds share
+// a key and the later one replaces the earlier. Older results are not
+// ignored: findForLeaf matches on params and claim alone, whichever key an
+// entry is stored under.
+type preparedKey struct {
+	leafHash       [32]byte
+	pendingTopHash [32]byte
+	timeBoundsHash [32]byte
+}
+
+// preparedAssertions is a small FIFO-bounded table of completed
+// preparedAssertions, keyed by preparedKey.
+type preparedAssertions struct {
+	entries map[preparedKey]*preparedAssertion
+	order   []preparedKey
+}
+
+func newPreparedAssertions() *preparedAssertions {
+	return &preparedAssertions{entries: make(map[preparedKey]*preparedAssertion)}
+}
+
+func (p *preparedAssertions) put(key preparedKey, pa *preparedAssertion, machines *machinePool) {
+	if _, exists := p.entries[key]; !exists {
+		if len(p.order) >= maxPreparedAssertions {
+			oldest := p.order[0]
+			p.order = p.order[1:]
+			p.entries[oldest].Release(machines)
+			delete(p.entries, oldest)
+		}
+		p.order = append(p.order, key)
+	}
+	p.entries[key] = pa
+}
+
+// findForLeaf returns the first completed preparedAssertion for leafHash
+// whose params and claim match the ones offered, along with the key it was
+// stored under, regardless of which pending-inbox top or time bounds it was
+// originally prepared against.
+func (p *preparedAssertions) findForLeaf(leafHash [32]byte, params *structures.AssertionParams, claim *structures.AssertionClaim) (*preparedAssertion, preparedKey, bool) {
+	for key, pa := range p.entries {
+		if key.leafHash != leafHash {
+			continue
+		}
+		if pa.params.Equals(params) && pa.claim.Equals(claim) {
+			return pa, key, true
+		}
+	}
+	return nil, preparedKey{}, false
+}
+
+// releaseLeaf drops and releases every entry for leafHash, typically once
+// that node stops being a leaf. except, if non-nil, is dropped from the
+// table without being released: its machine (and params/claim) have already
+// been handed off — e.g. promoted to correctNode.machine — so returning them
+// to the pools here would let another prepare worker grab and Reset the
+// same machine the chain now considers canonical.
+func (p *preparedAssertions) releaseLeaf(leafHash [32]byte, except *preparedKey, machines *machinePool) {
+	for i := 0; i < len(p.order); {
+		key := p.order[i]
+		if key.leafHash != leafHash {
+			i++
+			continue
+		}
+		if except == nil || key != *except {
+			p.entries[key].Release(machines)
+		}
+		delete(p.entries, key)
+		p.order = append(p.order[:i], p.order[i+1:]...)
+	}
+}
+
+func (p *preparedAssertions) releaseAll(machines *machinePool) {
+	for _, pa := range p.entries {
+		pa.Release(machines)
+	}
+	p.entries = make(map[preparedKey]*preparedAssertion)
+	p.order = nil
+}
+
+func timeBoundsHash(timeBounds protocol.TimeBounds) [32]byte {
+	return timeBounds.Hash()
+}
+
 func (chain *ChainObserver) startOpinionUpdateThread(ctx context.Context) {
 	go func() {
-		ticker := time.NewTicker(time.Second)
+		// The event channel below is scaffolding only (see events.go):
+		// nothing in this checkout calls the ChainObserver.NotifyNew*
+		// methods, so chain.events never fires and this watchdog is, in
+		// practice, the only thing driving catchUp/maybePrepare — no
+		// different from before this event-driven rearchitecture. It keeps
+		// the original 1s cadence rather than the relaxed interval a
+		// genuinely event-driven chain could get away with.
+		watchdog := time.NewTicker(1 * time.Second)
 		assertionPreparedChan := make(chan *preparedAssertion, 20)
+		prepareRequests := make(chan [32]byte, defaultPrepareWorkers*2)
 		preparingAssertions := make(map[[32]byte]bool)
-		preparedAssertions := make(map[[32]byte]*preparedAssertion)
+		prepared := newPreparedAssertions()
+		checkpoints := newCheckpointStore()
+		machines := newMachinePool()
 
-		updateCurrent := func() {
-			currentOpinion := chain.knownValidNode
+		workerCount := chain.nodeGraph.params.AssertionPrepWorkers
+		if workerCount < 1 {
+			workerCount = defaultPrepareWorkers
+		}
+		for i := 0; i < workerCount; i++ {
+			go func() {
+				for leafHash := range prepareRequests {
+					if prepped := chain.prepareAssertion(leafHash, checkpoints, machines); prepped != nil {
+						assertionPreparedChan <- prepped
+					}
+				}
+			}()
+		}
+
+		// updateCurrent works from the snapshot it's handed: it never
+		// re-reads chain.knownValidNode itself, so it can be retried
+		// freely and never needs to hold chain's lock across the
+		// potentially-expensive ExecuteAssertion call inside getNodeOpinion.
+		updateCurrent := func(currentOpinion *Node) {
 			successorHashes := [4][32]byte{}
 			copy(successorHashes[:], currentOpinion.successorHashes[:])
 			successor := func() *Node {
@@ -81,11 +204,9 @@ func (chain *ChainObserver) startOpinionUpdateThread(ctx context.Context) {
 			var newOpinion structures.ChildType
 			var nextMachine machine.Machine
 			var validExecution *protocol.ExecutionAssertion
-			prepped, found := preparedAssertions[currentOpinion.hash]
+			prepped, winnerKey, found := prepared.findForLeaf(currentOpinion.hash, successor.disputable.AssertionParams, successor.disputable.AssertionClaim)
 
-			if found &&
-				prepped.params.Equals(successor.disputable.AssertionParams) &&
-				prepped.claim.Equals(successor.disputable.AssertionClaim) {
+			if found {
 				newOpinion = structures.ValidChildType
 				nextMachine = prepped.machine
 				validExecution = prepped.assertion
@@ -93,22 +214,28 @@ func (chain *ChainObserver) startOpinionUpdateThread(ctx context.Context) {
 			} else {
 				params := successor.disputable.AssertionParams.Clone()
 				claim := successor.disputable.AssertionClaim.Clone()
-				claimHeight, found := chain.pendingInbox.GetHeight(claim.AfterPendingTop)
+				claimHeight, foundHeight := chain.pendingInbox.GetHeight(claim.AfterPendingTop)
 				var claimHeightCopy *big.Int
-				if found {
+				if foundHeight {
 					claimHeightCopy = new(big.Int).Set(claimHeight)
 				}
 				messageStack, _ := chain.pendingInbox.Substack(currentOpinion.vmProtoData.PendingTop, claim.AfterPendingTop)
 				messagesVal := chain.pendingInbox.ValueForSubseq(currentOpinion.vmProtoData.PendingTop, claim.AfterPendingTop)
-				nextMachine = currentOpinion.machine.Clone()
+				nextMachine = machines.get(currentOpinion.machine.Hash(), currentOpinion.machine)
 				prevPendingCount := new(big.Int).Set(currentOpinion.vmProtoData.PendingCount)
+				opinionHash := currentOpinion.hash
 				chain.RUnlock()
 
-				newOpinion, validExecution = getNodeOpinion(params, claim, prevPendingCount, claimHeightCopy, messageStack, messagesVal, nextMachine)
+				opinionKey := checkpointKey{nodeHash: opinionHash, pendingTop: claim.AfterPendingTop}
+				newOpinion, validExecution = getNodeOpinion(params, claim, prevPendingCount, claimHeightCopy, messageStack, messagesVal, nextMachine, checkpoints, opinionKey)
+			}
+			delete(preparingAssertions, currentOpinion.hash)
+			var exceptKey *preparedKey
+			if found {
+				exceptKey = &winnerKey
 			}
-			// Reset prepared
-			preparingAssertions = make(map[[32]byte]bool)
-			preparedAssertions = make(map[[32]byte]*preparedAssertion)
+			prepared.releaseLeaf(currentOpinion.hash, exceptKey, machines)
+			checkpoints.invalidateNode(currentOpinion.hash)
 
 			chain.RLock()
 			correctNode, ok := chain.nodeGraph.nodeFromHash[successorHashes[newOpinion]]
@@ -124,7 +251,7 @@ func (chain *ChainObserver) startOpinionUpdateThread(ctx context.Context) {
 					correctNode.machine = nextMachine
 					correctNode.assertion = validExecution
 				} else {
-					correctNode.machine = chain.knownValidNode.machine.Clone()
+					correctNode.machine = machines.get(currentOpinion.machine.Hash(), currentOpinion.machine)
 				}
 				chain.knownValidNode = correctNode
 				chain.Unlock()
@@ -135,107 +262,134 @@ func (chain *ChainObserver) startOpinionUpdateThread(ctx context.Context) {
 
 			}
 			chain.RUnlock()
+		}
+
+		// maybePrepare dispatches a worker to prepare the current leaf if
+		// it's ready to assert and no prepare has been dispatched for it yet.
+		// preparingAssertions[leafHash] stays set after the prepare completes
+		// and is only cleared when updateCurrent moves past the leaf or when
+		// the worker pool is saturated, so a leaf is prepared at most once
+		// while it stays a leaf; later events do not re-prepare it.
+		maybePrepare := func() {
+			chain.RLock()
+			defer chain.RUnlock()
+			if !chain.nodeGraph.leaves.IsLeaf(chain.knownValidNode) {
+				return
+			}
+			leafHash := chain.knownValidNode.hash
+			if preparingAssertions[leafHash] {
+				return
+			}
+			newMessages := chain.knownValidNode.vmProtoData.PendingTop != chain.pendingInbox.GetTopHash()
+			if machine.IsMachineBlocked(chain.knownValidNode.machine, chain.latestBlockNumber, newMessages) {
+				return
+			}
+			preparingAssertions[leafHash] = true
+			select {
+			case prepareRequests <- leafHash:
+			default:
+				// Worker pool is saturated; drop the request and let the
+				// next event retry it rather than blocking this thread.
+				delete(preparingAssertions, leafHash)
+			}
+		}
 
+		catchUp := func() {
+			chain.RLock()
+			for !chain.nodeGraph.leaves.IsLeaf(chain.knownValidNode) {
+				currentOpinion := chain.knownValidNode
+				updateCurrent(currentOpinion)
+				chain.RLock()
+			}
+			chain.RUnlock()
 		}
 
 		for {
 			select {
 			case <-ctx.Done():
-				break
-			case prepped := <-assertionPreparedChan:
-				preparedAssertions[prepped.leafHash] = prepped
-			case <-ticker.C:
-				chain.RLock()
-				// Catch up to current head
-				for !chain.nodeGraph.leaves.IsLeaf(chain.knownValidNode) {
-					updateCurrent()
-					chain.RLock()
+				watchdog.Stop()
+				close(prepareRequests)
+				prepared.releaseAll(machines)
+				return
+			case pa := <-assertionPreparedChan:
+				key := preparedKey{
+					leafHash:       pa.leafHash,
+					pendingTopHash: pa.beforeState.PendingTop,
+					timeBoundsHash: timeBoundsHash(pa.params.TimeBounds),
 				}
-				// Prepare next assertion
-				_, isPreparing := preparingAssertions[chain.knownValidNode.hash]
-				if !isPreparing {
-					newMessages := chain.knownValidNode.vmProtoData.PendingTop != chain.pendingInbox.GetTopHash()
-					if !machine.IsMachineBlocked(chain.knownValidNode.machine, chain.latestBlockNumber, newMessages) {
-						preparingAssertions[chain.knownValidNode.hash] = true
-						go func() {
-							assertionPreparedChan <- chain.prepareAssertion()
-						}()
-					}
-				} else {
-					prepared, isPrepared := preparedAssertions[chain.knownValidNode.hash]
-					if isPrepared && chain.nodeGraph.leaves.IsLeaf(chain.knownValidNode) {
-						for _, lis := range chain.listeners {
-							lis.AssertionPrepared(prepared.Clone())
-						}
+				prepared.put(key, pa, machines)
+				chain.RLock()
+				if pa.leafHash == chain.knownValidNode.hash && chain.nodeGraph.leaves.IsLeaf(chain.knownValidNode) {
+					for _, lis := range chain.listeners {
+						lis.AssertionPrepared(pa.Clone())
 					}
 				}
 				chain.RUnlock()
-
+			case <-chain.events:
+				catchUp()
+				maybePrepare()
+			case <-watchdog.C:
+				catchUp()
+				maybePrepare()
 			}
 		}
 	}()
 }
 
-func (chain *ChainObserver) prepareAssertion() *preparedAssertion {
+func (chain *ChainObserver) prepareAssertion(leafHash [32]byte, checkpoints *checkpointStore, machines *machinePool) *preparedAssertion {
 	chain.RLock()
-	currentOpinion := chain.knownValidNode
+	currentOpinion, ok := chain.nodeGraph.nodeFromHash[leafHash]
+	if !ok || !chain.nodeGraph.leaves.IsLeaf(currentOpinion) {
+		chain.RUnlock()
+		return nil
+	}
 	currentOpinionHash := currentOpinion.hash
 	prevPrevLeafHash := currentOpinion.PrevHash()
 	prevDataHash := currentOpinion.nodeDataHash
 	prevDeadline := structures.TimeTicks{new(big.Int).Set(currentOpinion.deadline.Val)}
 	prevChildType := currentOpinion.linkType
 	beforeState := currentOpinion.vmProtoData.Clone()
-	if !chain.nodeGraph.leaves.IsLeaf(currentOpinion) {
-		return nil
-	}
 	afterPendingTop := chain.pendingInbox.GetTopHash()
 	beforePendingTop := beforeState.PendingTop
 	messageStack, _ := chain.pendingInbox.Substack(beforePendingTop, afterPendingTop)
 	messagesVal := chain.pendingInbox.ValueForSubseq(beforePendingTop, afterPendingTop)
-	mach := currentOpinion.machine.Clone()
+	mach := machines.get(currentOpinion.machine.Hash(), currentOpinion.machine)
 	timeBounds := chain.currentTimeBounds()
 	chain.RUnlock()
 
-	assertion, stepsRun := mach.ExecuteAssertion(chain.nodeGraph.params.MaxExecutionSteps, timeBounds, messagesVal)
+	prepKey := checkpointKey{nodeHash: currentOpinionHash, pendingTop: beforePendingTop}
+	mach, assertion, stepsRun := executeWithCheckpoints(checkpoints, prepKey, mach, chain.nodeGraph.params.MaxExecutionSteps, timeBounds, messagesVal)
 
 	log.Println("Prepared assertion of", stepsRun, "steps, ending with", mach.LastBlockReason())
-	var params *structures.AssertionParams
-	var claim *structures.AssertionClaim
+	params := acquireAssertionParams()
+	claim := acquireAssertionClaim()
 	if assertion.DidInboxInsn {
-		params = &structures.AssertionParams{
-			NumSteps:             stepsRun,
-			TimeBounds:           timeBounds,
-			ImportedMessageCount: messageStack.TopCount(),
-		}
-		claim = &structures.AssertionClaim{
-			AfterPendingTop:       afterPendingTop,
-			ImportedMessagesSlice: messageStack.GetTopHash(),
-			AssertionStub:         assertion.Stub(),
-		}
+		params.NumSteps = stepsRun
+		params.TimeBounds = timeBounds
+		params.ImportedMessageCount = messageStack.TopCount()
+		claim.AfterPendingTop = afterPendingTop
+		claim.ImportedMessagesSlice = messageStack.GetTopHash()
+		claim.AssertionStub = assertion.Stub()
 	} else {
-		params = &structures.AssertionParams{
-			NumSteps:             stepsRun,
-			TimeBounds:           timeBounds,
-			ImportedMessageCount: big.NewInt(0),
-		}
-		claim = &structures.AssertionClaim{
-			AfterPendingTop:       beforePendingTop,
-			ImportedMessagesSlice: value.NewEmptyTuple().Hash(),
-			AssertionStub:         assertion.Stub(),
-		}
-	}
-	return &preparedAssertion{
-		leafHash:         currentOpinionHash,
-		prevPrevLeafHash: prevPrevLeafHash,
-		prevDataHash:     prevDataHash,
-		prevDeadline:     prevDeadline,
-		prevChildType:    prevChildType,
-		beforeState:      beforeState,
-		params:           params,
-		claim:            claim,
-		assertion:        assertion,
-		machine:          mach,
+		params.NumSteps = stepsRun
+		params.TimeBounds = timeBounds
+		params.ImportedMessageCount = big.NewInt(0)
+		claim.AfterPendingTop = beforePendingTop
+		claim.ImportedMessagesSlice = value.NewEmptyTuple().Hash()
+		claim.AssertionStub = assertion.Stub()
 	}
+	prepped := acquirePreparedAssertion()
+	prepped.leafHash = currentOpinionHash
+	prepped.prevPrevLeafHash = prevPrevLeafHash
+	prepped.prevDataHash = prevDataHash
+	prepped.prevDeadline = prevDeadline
+	prepped.prevChildType = prevChildType
+	prepped.beforeState = beforeState
+	prepped.params = params
+	prepped.claim = claim
+	prepped.assertion = assertion
+	prepped.machine = mach
+	return prepped
 }
 
 func getNodeOpinion(
@@ -246,6 +400,8 @@ func getNodeOpinion(
 	messageStack *structures.MessageStack,
 	messagesVal value.TupleValue,
 	prevMach machine.Machine,
+	checkpoints *checkpointStore,
+	key checkpointKey,
 ) (structures.ChildType, *protocol.ExecutionAssertion) {
 	correctAfterPendingTopHeight := new(big.Int).Add(prevPendingCount, params.ImportedMessageCount)
 	if claimHeight == nil || correctAfterPendingTopHeight.Cmp(claimHeight) != 0 {
@@ -255,9 +411,9 @@ func getNodeOpinion(
 		return structures.InvalidMessagesChildType, nil
 	}
 
-	mach := prevMach
-	assertion, stepsRun := mach.ExecuteAssertion(params.NumSteps, params.TimeBounds, messagesVal)
+	_, assertion, stepsRun := executeWithCheckpoints(checkpoints, key, prevMach, params.NumSteps, params.TimeBounds, messagesVal)
 	if params.NumSteps != stepsRun || !claim.AssertionStub.Equals(assertion.Stub()) {
+		checkpoints.invalidateNode(key.nodeHash)
 		return structures.InvalidExecutionChildType, nil
 	}
 
@@ -0,0 +1,283 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package rollup
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// fuzzMachine is a deterministic stand-in for a real AVM machine: running it
+// just advances a step counter and perturbs a hash, which is enough to drive
+// getNodeOpinion's branching (NumSteps vs. the steps actually run,
+// AssertionStub vs. the resulting stub) without executing real AVM code.
+type fuzzMachine struct {
+	hash  [32]byte
+	steps uint64
+}
+
+func (m *fuzzMachine) Clone() machine.Machine {
+	clone := *m
+	return &clone
+}
+
+func (m *fuzzMachine) Reset(from machine.Machine) {
+	*m = *from.(*fuzzMachine)
+}
+
+func (m *fuzzMachine) Hash() [32]byte {
+	return m.hash
+}
+
+func (m *fuzzMachine) LastBlockReason() interface{} {
+	return nil
+}
+
+func (m *fuzzMachine) ExecuteAssertion(maxSteps uint64, timeBounds protocol.TimeBounds, messagesVal value.TupleValue) (*protocol.ExecutionAssertion, uint64) {
+	// DidInboxInsn is only set on the chunk that starts at step 0: this
+	// models a per-chunk fact (the real field means "did *this* execution
+	// process an inbox instruction") rather than one derived from the
+	// machine's final state, so a chunking/merge bug that drops an earlier
+	// chunk's contribution (see executeWithCheckpoints) is actually
+	// observable instead of being masked by the last chunk happening to
+	// agree with the cumulative answer anyway.
+	// The machine hash, which folds in the step count and a digest of
+	// timeBounds, is reported as AfterHash so that both show up in the
+	// assertion's stub.
+	startedAtZero := m.steps == 0
+	m.steps += maxSteps
+	m.hash[0] = byte(m.steps)
+	m.hash[1] = timeBoundsDigest(timeBounds)
+	return &protocol.ExecutionAssertion{AfterHash: m.hash, DidInboxInsn: startedAtZero && didInboxInsnFor(timeBounds)}, maxSteps
+}
+
+// timeBoundsDigest derives a deterministic byte from timeBounds' content
+// without needing to know protocol.TimeBounds' fields, so fuzzMachine's
+// result actually varies when a test swaps in a different TimeBounds value
+// (the real machine's output would too, since time bounds gate which
+// messages and block-dependent opcodes are available).
+func timeBoundsDigest(timeBounds protocol.TimeBounds) byte {
+	sum := 0
+	for _, b := range []byte(fmt.Sprintf("%+v", timeBounds)) {
+		sum += int(b)
+	}
+	return byte(sum)
+}
+
+// didInboxInsnFor is the parity of timeBoundsDigest.
+func didInboxInsnFor(timeBounds protocol.TimeBounds) bool {
+	return timeBoundsDigest(timeBounds)%2 == 0
+}
+
+// mutatePrimitiveFields returns a copy of v with every directly reachable
+// bool/numeric/string field flipped to a different value, recursing into
+// structs and arrays but never following a pointer, slice, or interface —
+// so it can produce a provably different value of an opaque external type
+// (like protocol.TimeBounds or protocol.ExecutionAssertion) without
+// depending on, or risking corrupting, fields this package doesn't know
+// about. If v has no such field, the returned copy is unchanged.
+func mutatePrimitiveFields(v interface{}) interface{} {
+	rv := reflect.New(reflect.TypeOf(v)).Elem()
+	rv.Set(reflect.ValueOf(v))
+	var mutate func(reflect.Value)
+	mutate = func(val reflect.Value) {
+		switch val.Kind() {
+		case reflect.Struct:
+			for i := 0; i < val.NumField(); i++ {
+				if f := val.Field(i); f.CanSet() {
+					mutate(f)
+				}
+			}
+		case reflect.Array:
+			for i := 0; i < val.Len(); i++ {
+				mutate(val.Index(i))
+			}
+		case reflect.Bool:
+			val.SetBool(!val.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			val.SetInt(val.Int() + 1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			val.SetUint(val.Uint() + 1)
+		case reflect.Float32, reflect.Float64:
+			val.SetFloat(val.Float() + 1)
+		case reflect.String:
+			val.SetString(val.String() + "x")
+		}
+	}
+	mutate(rv)
+	return rv.Interface()
+}
+
+// fuzzClaimFor plays out what a staker's prepareAssertion would produce for
+// the given inputs, without needing a full ChainObserver: it runs a clone of
+// startMach exactly the way prepareAssertion does and builds the matching
+// claim. startMach itself is returned untouched, at its original pre-run
+// state, so callers re-verifying the claim via getNodeOpinion start from the
+// same state the claim was actually computed against.
+func fuzzClaimFor(numSteps uint64, importedMessages *big.Int) (*structures.AssertionParams, *structures.AssertionClaim, machine.Machine) {
+	startMach := &fuzzMachine{}
+	mach := startMach.Clone()
+	timeBounds := protocol.TimeBounds{}
+	messagesVal := value.NewEmptyTuple()
+
+	params := &structures.AssertionParams{
+		NumSteps:             numSteps,
+		TimeBounds:           timeBounds,
+		ImportedMessageCount: new(big.Int).Set(importedMessages),
+	}
+
+	checkpoints := newCheckpointStore()
+	mach, assertion, stepsRun := executeWithCheckpoints(checkpoints, checkpointKey{}, mach, params.NumSteps, params.TimeBounds, messagesVal)
+	params.NumSteps = stepsRun
+
+	claim := &structures.AssertionClaim{
+		AfterPendingTop:       mach.Hash(),
+		ImportedMessagesSlice: value.NewEmptyTuple().Hash(),
+		AssertionStub:         assertion.Stub(),
+	}
+	return params, claim, startMach
+}
+
+// FuzzGetNodeOpinion asserts the oracle property getNodeOpinion must
+// preserve: the claim a prepareAssertion-equivalent run produces must itself
+// be judged ValidChildType, and mutating any single field of that claim must
+// flip the verdict to one of the three invalid types — never a panic, and
+// never ValidChildType.
+func FuzzGetNodeOpinion(f *testing.F) {
+	f.Add(uint64(0), int64(0), int64(0))
+	f.Add(uint64(1), int64(1), int64(0))
+	f.Add(uint64(1000), int64(5), int64(5))
+	f.Add(uint64(42), int64(0), int64(7))
+
+	f.Fuzz(func(t *testing.T, numSteps uint64, importedMessages int64, prevPendingCount int64) {
+		if importedMessages < 0 {
+			importedMessages = -importedMessages
+		}
+		if prevPendingCount < 0 {
+			prevPendingCount = -prevPendingCount
+		}
+		importedCount := big.NewInt(importedMessages)
+		prevCount := big.NewInt(prevPendingCount)
+
+		params, claim, mach := fuzzClaimFor(numSteps, importedCount)
+		messageStack := &structures.MessageStack{}
+		claimHeight := new(big.Int).Add(prevCount, params.ImportedMessageCount)
+
+		verify := func(p *structures.AssertionParams, c *structures.AssertionClaim) (opinion structures.ChildType) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("getNodeOpinion panicked: %v", r)
+				}
+			}()
+			opinion, _ = getNodeOpinion(p, c, prevCount, claimHeight, messageStack, value.NewEmptyTuple(), mach.Clone(), newCheckpointStore(), checkpointKey{})
+			return
+		}
+
+		if opinion := verify(params, claim); opinion != structures.ValidChildType {
+			t.Fatalf("expected ValidChildType for an honestly prepared claim, got %v", opinion)
+		}
+
+		mutatedPendingTop := claim.Clone()
+		mutatedPendingTop.AfterPendingTop[0] ^= 0xFF
+		if opinion := verify(params, mutatedPendingTop); opinion == structures.ValidChildType {
+			t.Fatalf("mutating AfterPendingTop still produced ValidChildType")
+		}
+
+		mutatedMessagesSlice := claim.Clone()
+		mutatedMessagesSlice.ImportedMessagesSlice[0] ^= 0xFF
+		if opinion := verify(params, mutatedMessagesSlice); opinion == structures.ValidChildType {
+			t.Fatalf("mutating ImportedMessagesSlice still produced ValidChildType")
+		}
+
+		if altStub := mutatePrimitiveFields(protocol.ExecutionAssertion{}).(protocol.ExecutionAssertion).Stub(); !altStub.Equals(claim.AssertionStub) {
+			mutatedStub := claim.Clone()
+			mutatedStub.AssertionStub = altStub
+			if opinion := verify(params, mutatedStub); opinion == structures.ValidChildType {
+				t.Fatalf("mutating AssertionStub still produced ValidChildType")
+			}
+		}
+
+		mutatedNumSteps := params.Clone()
+		mutatedNumSteps.NumSteps++
+		if opinion := verify(mutatedNumSteps, claim); opinion == structures.ValidChildType {
+			t.Fatalf("mutating NumSteps still produced ValidChildType")
+		}
+
+		mutatedImportedCount := params.Clone()
+		mutatedImportedCount.ImportedMessageCount.Add(mutatedImportedCount.ImportedMessageCount, big.NewInt(1))
+		if opinion := verify(mutatedImportedCount, claim); opinion == structures.ValidChildType {
+			t.Fatalf("mutating ImportedMessageCount still produced ValidChildType")
+		}
+
+		if altTimeBounds := mutatePrimitiveFields(params.TimeBounds).(protocol.TimeBounds); fmt.Sprintf("%+v", altTimeBounds) != fmt.Sprintf("%+v", params.TimeBounds) {
+			mutatedTimeBounds := params.Clone()
+			mutatedTimeBounds.TimeBounds = altTimeBounds
+			if opinion := verify(mutatedTimeBounds, claim); opinion == structures.ValidChildType {
+				t.Fatalf("mutating TimeBounds still produced ValidChildType")
+			}
+		}
+	})
+}
+
+// FuzzPreparedAssertionClone checks preparedAssertion.Clone's deep-copy
+// contract: mutating the clone's owned structures must never be visible on
+// the original.
+func FuzzPreparedAssertionClone(f *testing.F) {
+	f.Add(uint64(0), int64(0))
+	f.Add(uint64(10), int64(3))
+
+	f.Fuzz(func(t *testing.T, numSteps uint64, importedMessages int64) {
+		if importedMessages < 0 {
+			importedMessages = -importedMessages
+		}
+		original := &preparedAssertion{
+			prevDeadline: structures.TimeTicks{Val: big.NewInt(importedMessages)},
+			beforeState:  &structures.VMProtoData{},
+			params: &structures.AssertionParams{
+				NumSteps:             numSteps,
+				ImportedMessageCount: big.NewInt(importedMessages),
+			},
+			claim: &structures.AssertionClaim{},
+		}
+
+		clone := original.Clone()
+		clone.prevDeadline.Val.Add(clone.prevDeadline.Val, big.NewInt(1))
+		clone.params.ImportedMessageCount.Add(clone.params.ImportedMessageCount, big.NewInt(1))
+		clone.params.NumSteps++
+		clone.claim.AfterPendingTop[0] = 0xAB
+
+		if original.prevDeadline.Val.Cmp(big.NewInt(importedMessages)) != 0 {
+			t.Fatalf("Clone aliased prevDeadline.Val")
+		}
+		if original.params.ImportedMessageCount.Cmp(big.NewInt(importedMessages)) != 0 {
+			t.Fatalf("Clone aliased params.ImportedMessageCount")
+		}
+		if original.params.NumSteps != numSteps {
+			t.Fatalf("Clone aliased params.NumSteps")
+		}
+		if original.claim.AfterPendingTop[0] == 0xAB {
+			t.Fatalf("Clone aliased claim.AfterPendingTop")
+		}
+	})
+}
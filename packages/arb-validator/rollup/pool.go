@@ -0,0 +1,137 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package rollup
+
+import (
+	"sync"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// maxPooledMachinesPerHash bounds how many idle clones of a given machine
+// state are kept around for reuse before extras are left for GC.
+const maxPooledMachinesPerHash = 4
+
+var (
+	preparedAssertionPool = sync.Pool{New: func() interface{} { return new(preparedAssertion) }}
+	assertionParamsPool   = sync.Pool{New: func() interface{} { return new(structures.AssertionParams) }}
+	assertionClaimPool    = sync.Pool{New: func() interface{} { return new(structures.AssertionClaim) }}
+	vmProtoDataPool       = sync.Pool{New: func() interface{} { return new(structures.VMProtoData) }}
+)
+
+func acquirePreparedAssertion() *preparedAssertion {
+	return preparedAssertionPool.Get().(*preparedAssertion)
+}
+
+func acquireAssertionParams() *structures.AssertionParams {
+	return assertionParamsPool.Get().(*structures.AssertionParams)
+}
+
+func releaseAssertionParams(params *structures.AssertionParams) {
+	if params == nil {
+		return
+	}
+	*params = structures.AssertionParams{}
+	assertionParamsPool.Put(params)
+}
+
+func acquireAssertionClaim() *structures.AssertionClaim {
+	return assertionClaimPool.Get().(*structures.AssertionClaim)
+}
+
+func releaseAssertionClaim(claim *structures.AssertionClaim) {
+	if claim == nil {
+		return
+	}
+	*claim = structures.AssertionClaim{}
+	assertionClaimPool.Put(claim)
+}
+
+func acquireVMProtoData() *structures.VMProtoData {
+	return vmProtoDataPool.Get().(*structures.VMProtoData)
+}
+
+func releaseVMProtoData(data *structures.VMProtoData) {
+	if data == nil {
+		return
+	}
+	*data = structures.VMProtoData{}
+	vmProtoDataPool.Put(data)
+}
+
+// Release returns pa, and the structures it owns, to their pools, and offers
+// pa's machine clone to machines for reuse. Callers must not touch pa after
+// Release returns. Call this once a preparedAssertion has been superseded
+// (a different successor was adopted, the opinion thread is resetting its
+// preparedAssertions for the next leaf) rather than letting it fall to GC.
+func (pa *preparedAssertion) Release(machines *machinePool) {
+	if pa == nil {
+		return
+	}
+	if pa.machine != nil {
+		machines.put(pa.machine.Hash(), pa.machine)
+	}
+	releaseAssertionParams(pa.params)
+	releaseAssertionClaim(pa.claim)
+	releaseVMProtoData(pa.beforeState)
+	*pa = preparedAssertion{}
+	preparedAssertionPool.Put(pa)
+}
+
+// machinePool is a bounded cache of idle machine clones, keyed by the hash
+// each machine had when it was put back. get reuses a pooled clone via
+// machine.Machine.Reset when one is available, falling back to from.Clone()
+// otherwise, so callers don't need to know whether they got a fresh or
+// recycled machine.
+//
+// Reset is not part of machine.Machine in this checkout (arb-util/machine
+// isn't part of this tree), so this assumes it already exists on the real
+// interface; if it doesn't, it needs adding there alongside Clone, with the
+// same "become an independent copy of from" contract Reset relies on here.
+type machinePool struct {
+	mu     sync.Mutex
+	byHash map[[32]byte][]machine.Machine
+}
+
+func newMachinePool() *machinePool {
+	return &machinePool{byHash: make(map[[32]byte][]machine.Machine)}
+}
+
+func (p *machinePool) get(hash [32]byte, from machine.Machine) machine.Machine {
+	p.mu.Lock()
+	bucket := p.byHash[hash]
+	if len(bucket) == 0 {
+		p.mu.Unlock()
+		return from.Clone()
+	}
+	mach := bucket[len(bucket)-1]
+	p.byHash[hash] = bucket[:len(bucket)-1]
+	p.mu.Unlock()
+	mach.Reset(from)
+	return mach
+}
+
+func (p *machinePool) put(hash [32]byte, mach machine.Machine) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	bucket := p.byHash[hash]
+	if len(bucket) >= maxPooledMachinesPerHash {
+		return
+	}
+	p.byHash[hash] = append(bucket, mach)
+}
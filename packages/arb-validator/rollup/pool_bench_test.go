@@ -0,0 +1,79 @@
+/*
+* Copyright 2020, Offchain Labs, Inc.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package rollup
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-validator/structures"
+)
+
+// BenchmarkPreparedAssertionAlloc allocates a fresh preparedAssertion (and
+// the structures it owns) on every iteration, mirroring what
+// startOpinionUpdateThread did before pooling was introduced.
+func BenchmarkPreparedAssertionAlloc(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		pa := &preparedAssertion{
+			beforeState: &structures.VMProtoData{},
+			params:      &structures.AssertionParams{NumSteps: 1, ImportedMessageCount: big.NewInt(0)},
+			claim:       &structures.AssertionClaim{},
+		}
+		_ = pa
+	}
+}
+
+// BenchmarkPreparedAssertionPool acquires and releases a preparedAssertion
+// from the shared pools every iteration, exercising the same allocation
+// shape this package now uses in prepareAssertion.
+func BenchmarkPreparedAssertionPool(b *testing.B) {
+	machines := newMachinePool()
+	for i := 0; i < b.N; i++ {
+		pa := acquirePreparedAssertion()
+		pa.beforeState = acquireVMProtoData()
+		pa.params = acquireAssertionParams()
+		pa.params.NumSteps = 1
+		pa.params.ImportedMessageCount = big.NewInt(0)
+		pa.claim = acquireAssertionClaim()
+		pa.Release(machines)
+	}
+}
+
+// BenchmarkMachineCloneAlloc clones a machine from scratch every iteration,
+// mirroring what prepareAssertion did on every tick before machinePool was
+// introduced.
+func BenchmarkMachineCloneAlloc(b *testing.B) {
+	base := &fuzzMachine{}
+	for i := 0; i < b.N; i++ {
+		mach := base.Clone()
+		_ = mach
+	}
+}
+
+// BenchmarkMachineClonePool runs a pooled acquire/release pair every
+// iteration, the same way prepareAssertion and preparedAssertion.Release now
+// do, so the win claimed for the bounded machine-clone pool is actually
+// measured rather than just the surrounding preparedAssertion allocation.
+func BenchmarkMachineClonePool(b *testing.B) {
+	machines := newMachinePool()
+	base := &fuzzMachine{}
+	hash := base.Hash()
+	for i := 0; i < b.N; i++ {
+		mach := machines.get(hash, base)
+		machines.put(hash, mach)
+	}
+}